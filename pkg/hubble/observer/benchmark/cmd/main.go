@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+// Command hubble-observer-benchmark runs a LocalObserverServer benchmark
+// harness against one or more load profiles defined in a YAML config file,
+// and prints the resulting metrics.
+//
+// Usage:
+//
+//	hubble-observer-benchmark -config load-config.yaml -profile steady-state
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cilium/cilium/pkg/hubble/observer/benchmark"
+)
+
+func main() {
+	configPath := flag.String("config", "load-config.yaml", "path to a load profile configuration file")
+	profileName := flag.String("profile", "", "name of the profile to run (default: run all profiles in the config)")
+	flag.Parse()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cfg, err := benchmark.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	profiles := cfg.Profiles
+	if *profileName != "" {
+		p, ok := cfg.Profile(*profileName)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "no such profile: %s\n", *profileName)
+			os.Exit(1)
+		}
+		profiles = []benchmark.Profile{p}
+	}
+
+	for _, profile := range profiles {
+		h, err := benchmark.NewHarness(profile, logger)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to build harness for profile %s: %s\n", profile.Name, err)
+			os.Exit(1)
+		}
+
+		result, err := h.Run(context.Background(), profile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to run profile %s: %s\n", profile.Name, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("profile=%s sent=%d delivered=%d drops=%d overwrites=%d hookCPU=%s p50=%s p90=%s p99=%s\n",
+			profile.Name, result.EventsSent, result.FlowsDelivered, result.Drops, result.RingOverwrites,
+			result.HookCPUTime, result.LatencyP50, result.LatencyP90, result.LatencyP99)
+	}
+}
@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	flowpb "github.com/cilium/cilium/api/v1/flow"
+	observerpb "github.com/cilium/cilium/api/v1/observer"
+	"github.com/cilium/cilium/pkg/hubble/observer"
+	"github.com/cilium/cilium/pkg/hubble/observer/observeroption"
+	observerTypes "github.com/cilium/cilium/pkg/hubble/observer/types"
+	"github.com/cilium/cilium/pkg/hubble/parser"
+	"github.com/cilium/cilium/pkg/hubble/testutils"
+	"github.com/cilium/cilium/pkg/monitor"
+	monitorAPI "github.com/cilium/cilium/pkg/monitor/api"
+)
+
+// Harness drives a LocalObserverServer with a synthetic load Profile and
+// collects latency, drop and ring-overwrite metrics while it runs.
+type Harness struct {
+	logger  *logrus.Logger
+	server  *observer.LocalObserverServer
+	metrics *metricsCollector
+}
+
+// NewHarness builds a LocalObserverServer configured according to profile
+// and returns a Harness ready to Run it.
+func NewHarness(profile Profile, logger *logrus.Logger) (*Harness, error) {
+	pp, err := parser.New(
+		logger,
+		&testutils.NoopEndpointGetter,
+		&testutils.NoopIdentityGetter,
+		&testutils.NoopDNSGetter,
+		&testutils.NoopIPGetter,
+		&testutils.NoopServiceGetter,
+		&testutils.NoopLinkGetter,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build payload parser: %w", err)
+	}
+
+	metrics := newMetricsCollector()
+	// Each hook below does the same minimal, representative amount of work a
+	// lightweight production hook would (reading a field off the event it
+	// was handed) so that HookCPUTime reflects actual per-event hook cost
+	// rather than just the time to read the clock twice.
+	onMonitorEvent := func(ctx context.Context, ev *observerTypes.MonitorEvent) (bool, error) {
+		start := time.Now()
+		_ = ev.NodeName
+		metrics.recordHookCPU(time.Since(start))
+		return false, nil
+	}
+	onDecodedFlow := func(ctx context.Context, flow *flowpb.Flow) (bool, error) {
+		start := time.Now()
+		_ = flow.GetNodeName()
+		metrics.recordHookCPU(time.Since(start))
+		return false, nil
+	}
+	onFlowDelivery := func(ctx context.Context, flow *flowpb.Flow) (bool, error) {
+		start := time.Now()
+		_ = flow.GetNodeName()
+		metrics.recordHookCPU(time.Since(start))
+		return false, nil
+	}
+
+	s, err := observer.NewLocalServer(pp, logger,
+		observeroption.WithMaxFlows(profile.RingBufferCapacity),
+		observeroption.WithMonitorBuffer(profile.MonitorBufferSize),
+		observeroption.WithOnMonitorEventFunc(onMonitorEvent),
+		observeroption.WithOnDecodedFlowFunc(onDecodedFlow),
+		observeroption.WithOnFlowDeliveryFunc(onFlowDelivery),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build observer server: %w", err)
+	}
+
+	return &Harness{logger: logger, server: s, metrics: metrics}, nil
+}
+
+// Run executes the profile to completion: it starts the server, paces
+// synthetic events into it at the profile's target rate for profile.Duration
+// while running the configured number of concurrent subscribers, and
+// returns the collected Result once everything has drained.
+func (h *Harness) Run(ctx context.Context, profile Profile) (Result, error) {
+	if err := h.server.Start(context.Background()); err != nil {
+		return Result{}, fmt.Errorf("failed to start observer server: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, profile.Duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < profile.Subscribers; i++ {
+		follow := i < profile.FollowSubscribers
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.runSubscriber(ctx, follow)
+		}()
+	}
+
+	h.pace(ctx, profile)
+
+	close(h.server.GetEventsChannel())
+	<-h.server.GetStopped()
+	wg.Wait()
+
+	status, err := h.server.ServerStatus(context.Background(), &observerpb.ServerStatusRequest{})
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to fetch final server status: %w", err)
+	}
+	// The ring buffer only ever holds MaxFlows entries, so once more than
+	// that many have been seen, each one in excess overwrote an older
+	// entry.
+	if status.GetSeenFlows() > status.GetMaxFlows() {
+		h.metrics.recordRingOverwrites(int(status.GetSeenFlows() - status.GetMaxFlows()))
+	}
+	return h.metrics.result(profile, status.GetSeenFlows()), nil
+}
+
+// pace feeds synthetic events into the server's monitor channel at
+// profile.EventsPerSecond using a simple token-bucket: one token is minted
+// per tick and immediately spent on the next event, which caps the rate
+// without busy-waiting.
+func (h *Harness) pace(ctx context.Context, profile Profile) {
+	if profile.EventsPerSecond <= 0 {
+		return
+	}
+	interval := time.Second / time.Duration(profile.EventsPerSecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	m := h.server.GetEventsChannel()
+	var i int
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m <- h.nextEvent(profile, i)
+			h.metrics.recordEventSent()
+			i++
+		}
+	}
+}
+
+func (h *Harness) nextEvent(profile Profile, i int) *observerTypes.MonitorEvent {
+	now := time.Now()
+	node := fmt.Sprintf("node #%03d", i)
+
+	total := profile.PayloadMix.TraceNotify + profile.PayloadMix.DropNotify + profile.PayloadMix.AgentEvent
+	if total <= 0 {
+		total = 1
+	}
+	pick := float64(i%100) / 100 * total
+
+	switch {
+	case pick < profile.PayloadMix.AgentEvent:
+		return &observerTypes.MonitorEvent{
+			Timestamp: now,
+			NodeName:  node,
+			Payload: &observerTypes.AgentEvent{
+				Type:    monitorAPI.MessageTypeAgent,
+				Message: monitorAPI.ServiceDeleteMessage(uint32(i)),
+			},
+		}
+	case pick < profile.PayloadMix.AgentEvent+profile.PayloadMix.DropNotify:
+		dn := monitor.DropNotify{Type: byte(monitorAPI.MessageTypeDrop)}
+		return &observerTypes.MonitorEvent{
+			Timestamp: now,
+			NodeName:  node,
+			Payload: &observerTypes.PerfEvent{
+				Data: testutils.MustCreateL3L4Payload(dn),
+				CPU:  0,
+			},
+		}
+	default:
+		tn := monitor.TraceNotifyV0{Type: byte(monitorAPI.MessageTypeTrace)}
+		return &observerTypes.MonitorEvent{
+			Timestamp: now,
+			NodeName:  node,
+			Payload: &observerTypes.PerfEvent{
+				Data: testutils.MustCreateL3L4Payload(tn),
+				CPU:  0,
+			},
+		}
+	}
+}
+
+// runSubscriber runs a single GetFlows subscriber, recording per-flow
+// delivery latency. A Follow subscriber runs until ctx is cancelled; a
+// windowed one returns once it reaches the end of the ring buffer.
+func (h *Harness) runSubscriber(ctx context.Context, follow bool) {
+	req := &observerpb.GetFlowsRequest{Follow: follow}
+	fakeServer := &testutils.FakeGetFlowsServer{
+		OnSend: func(response *observerpb.GetFlowsResponse) error {
+			if err := response.GetTime().CheckValid(); err == nil {
+				h.metrics.recordDelivery(time.Since(response.GetTime().AsTime()))
+			}
+			select {
+			case <-ctx.Done():
+				return io.EOF
+			default:
+				return nil
+			}
+		},
+		FakeGRPCServerStream: &testutils.FakeGRPCServerStream{
+			OnContext: func() context.Context {
+				return ctx
+			},
+		},
+	}
+	// A non-nil, non-EOF error here just means the subscriber's context
+	// was cancelled while blocked waiting for the next flow; that is the
+	// normal way a Run() call winds a subscriber down.
+	_ = h.server.GetFlows(req, fakeServer)
+}
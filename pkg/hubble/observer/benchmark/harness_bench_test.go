@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+//go:build !privileged_tests
+// +build !privileged_tests
+
+package benchmark
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cilium/cilium/pkg/hubble/container"
+)
+
+// defaultBenchProfile exercises a modest sustained load against both
+// windowed and Follow subscribers; it is intentionally small so that
+// `go test -bench` stays fast by default. BenchmarkHarness_Run always runs
+// this profile; load-config.yaml profiles are run through LoadConfig and
+// NewHarness, as the hubble-observer-benchmark command does.
+var defaultBenchProfile = Profile{
+	Name:               "default",
+	EventsPerSecond:    1000,
+	Duration:           200 * time.Millisecond,
+	PayloadMix:         PayloadMix{TraceNotify: 0.8, DropNotify: 0.15, AgentEvent: 0.05},
+	RingBufferCapacity: container.Capacity127,
+	MonitorBufferSize:  64,
+	Subscribers:        4,
+	FollowSubscribers:  2,
+}
+
+func BenchmarkHarness_Run(b *testing.B) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	for i := 0; i < b.N; i++ {
+		h, err := NewHarness(defaultBenchProfile, logger)
+		if err != nil {
+			b.Fatalf("failed to build harness: %s", err)
+		}
+		result, err := h.Run(context.Background(), defaultBenchProfile)
+		if err != nil {
+			b.Fatalf("failed to run profile: %s", err)
+		}
+		b.ReportMetric(float64(result.LatencyP99.Microseconds()), "p99-us/op")
+		b.ReportMetric(float64(result.RingOverwrites), "overwrites/op")
+	}
+}
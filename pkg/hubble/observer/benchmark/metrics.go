@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+package benchmark
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Result is the set of metrics collected from a single profile run.
+type Result struct {
+	Profile Profile
+
+	// EventsSent is the number of events the pacer fed into the server.
+	EventsSent int
+	// FlowsDelivered is the number of flows observed across all
+	// subscribers' OnSend callbacks.
+	FlowsDelivered int
+	// Drops is the number of dropped events reported by ServerStatus at the
+	// end of the run (SeenFlows vs. events actually sent).
+	Drops uint64
+	// RingOverwrites is the number of ring buffer writes beyond its
+	// capacity, each of which replaced an older entry. Whether a subscriber
+	// had read the replaced entry is not tracked.
+	RingOverwrites int
+	// HookCPUTime is the cumulative time spent inside OnMonitorEvent,
+	// OnDecodedFlow and OnFlowDelivery hooks during the run.
+	HookCPUTime time.Duration
+
+	// LatencyP50, LatencyP90 and LatencyP99 are end-to-end latency
+	// percentiles measured from an event's original timestamp to the
+	// moment it was handed to a subscriber's OnSend.
+	LatencyP50 time.Duration
+	LatencyP90 time.Duration
+	LatencyP99 time.Duration
+}
+
+// metricsCollector accumulates samples for a single profile run across
+// concurrently running pacer and subscriber goroutines.
+type metricsCollector struct {
+	mu sync.Mutex
+
+	eventsSent     int
+	flowsDelivered int
+	ringOverwrites int
+	hookCPUTime    time.Duration
+	latencies      []time.Duration
+}
+
+func newMetricsCollector() *metricsCollector {
+	return &metricsCollector{}
+}
+
+func (c *metricsCollector) recordEventSent() {
+	c.mu.Lock()
+	c.eventsSent++
+	c.mu.Unlock()
+}
+
+func (c *metricsCollector) recordDelivery(latency time.Duration) {
+	c.mu.Lock()
+	c.flowsDelivered++
+	c.latencies = append(c.latencies, latency)
+	c.mu.Unlock()
+}
+
+func (c *metricsCollector) recordRingOverwrites(n int) {
+	if n <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.ringOverwrites += n
+	c.mu.Unlock()
+}
+
+func (c *metricsCollector) recordHookCPU(d time.Duration) {
+	c.mu.Lock()
+	c.hookCPUTime += d
+	c.mu.Unlock()
+}
+
+// result computes a Result snapshot, including latency percentiles, from the
+// samples collected so far. seenFlows comes from a final ServerStatus call.
+func (c *metricsCollector) result(profile Profile, seenFlows uint64) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	latencies := append([]time.Duration(nil), c.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var drops uint64
+	if uint64(c.eventsSent) > seenFlows {
+		drops = uint64(c.eventsSent) - seenFlows
+	}
+
+	return Result{
+		Profile:        profile,
+		EventsSent:     c.eventsSent,
+		FlowsDelivered: c.flowsDelivered,
+		Drops:          drops,
+		RingOverwrites: c.ringOverwrites,
+		HookCPUTime:    c.hookCPUTime,
+		LatencyP50:     percentile(latencies, 0.50),
+		LatencyP90:     percentile(latencies, 0.90),
+		LatencyP99:     percentile(latencies, 0.99),
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p * float64(len(sorted)))
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
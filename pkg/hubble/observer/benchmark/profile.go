@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+// Package benchmark drives a LocalObserverServer under configurable
+// synthetic load profiles, turning the ring-buffer correctness issues
+// tracked by the observer package's unit tests into a reproducible
+// performance regression gate.
+package benchmark
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cilium/cilium/pkg/hubble/container"
+)
+
+// PayloadMix describes the relative proportion of each event kind the
+// pacer should generate. The three ratios do not need to sum to 1; they are
+// normalized when a profile is run.
+type PayloadMix struct {
+	TraceNotify float64 `yaml:"traceNotify"`
+	DropNotify  float64 `yaml:"dropNotify"`
+	AgentEvent  float64 `yaml:"agentEvent"`
+}
+
+// Profile describes one synthetic load scenario to run against a
+// LocalObserverServer.
+type Profile struct {
+	// Name identifies the profile in reported metrics.
+	Name string `yaml:"name"`
+	// EventsPerSecond is the target rate at which the pacer feeds events
+	// into the server's monitor channel.
+	EventsPerSecond int `yaml:"eventsPerSecond"`
+	// Duration is how long the profile runs for.
+	Duration time.Duration `yaml:"duration"`
+	// PayloadMix is the ratio of event kinds to generate.
+	PayloadMix PayloadMix `yaml:"payloadMix"`
+	// RingBufferCapacity configures observeroption.WithMaxFlows for the run.
+	RingBufferCapacity container.Capacity `yaml:"ringBufferCapacity"`
+	// MonitorBufferSize configures observeroption.WithMonitorBuffer for the
+	// run.
+	MonitorBufferSize int `yaml:"monitorBufferSize"`
+	// Subscribers is the number of concurrent GetFlows subscribers to run
+	// against the server while the profile is active.
+	Subscribers int `yaml:"subscribers"`
+	// FollowSubscribers is the number of those subscribers, out of
+	// Subscribers, that issue a Follow: true request rather than a bounded
+	// windowed one.
+	FollowSubscribers int `yaml:"followSubscribers"`
+}
+
+// Config is the top-level structure of a load-config.yaml file: a named set
+// of profiles that a benchmark run can select from by name.
+type Config struct {
+	Profiles []Profile `yaml:"profiles"`
+}
+
+// LoadConfig reads and parses a load profile configuration file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load profile config %q: %w", path, err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse load profile config %q: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Profile looks up a profile by name.
+func (c *Config) Profile(name string) (Profile, bool) {
+	for _, p := range c.Profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
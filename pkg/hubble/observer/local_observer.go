@@ -0,0 +1,476 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+// Package observer implements the Hubble observer gRPC service on top of a
+// local, in-memory ring buffer of flows and agent events.
+package observer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	flowpb "github.com/cilium/cilium/api/v1/flow"
+	observerpb "github.com/cilium/cilium/api/v1/observer"
+	"github.com/cilium/cilium/pkg/hubble/container"
+	"github.com/cilium/cilium/pkg/hubble/observer/observeroption"
+	observerTypes "github.com/cilium/cilium/pkg/hubble/observer/types"
+	"github.com/cilium/cilium/pkg/hubble/observer/wal"
+	"github.com/cilium/cilium/pkg/hubble/parser"
+	v1 "github.com/cilium/cilium/pkg/hubble/parser/types"
+	"github.com/cilium/cilium/pkg/hubble/service"
+)
+
+// LocalObserverServer is an implementation of the observer.ObserverServer
+// interface backed by a ring buffer that is filled from a local monitor
+// event channel.
+type LocalObserverServer struct {
+	*service.BaseService
+
+	logger           *logrus.Logger
+	ring             *container.Ring
+	ringWindow       *ringWindow
+	eventschan       chan *observerTypes.MonitorEvent
+	payloadParser    *parser.Parser
+	startTime        time.Time
+	numObservedFlows uint64
+	opts             observeroption.Options
+
+	// wal is non-nil when the server was configured with
+	// observeroption.WithWAL, and mirrors every accepted flow and agent
+	// event to disk before it enters the ring buffer.
+	wal *wal.WAL
+}
+
+// NewLocalServer creates a new LocalObserverServer that reads events from a
+// monitor channel and writes them into an in-memory ring buffer.
+func NewLocalServer(payloadParser *parser.Parser, logger *logrus.Logger, options ...observeroption.Option) (*LocalObserverServer, error) {
+	opts := observeroption.Default
+	for _, opt := range options {
+		if err := opt(&opts); err != nil {
+			return nil, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
+	ring := container.NewRing(opts.MaxFlows)
+	s := &LocalObserverServer{
+		BaseService:   service.NewBaseService(logger, "local-observer"),
+		logger:        logger,
+		ring:          ring,
+		ringWindow:    newRingWindow(int(ring.Cap())),
+		eventschan:    make(chan *observerTypes.MonitorEvent, opts.MonitorBuffer),
+		payloadParser: payloadParser,
+		startTime:     time.Now(),
+		opts:          opts,
+	}
+
+	if opts.WALDir != "" {
+		w, err := wal.Open(opts.WALDir, opts.WALOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open WAL at %q: %w", opts.WALDir, err)
+		}
+		s.wal = w
+
+		records, err := w.Replay(time.Time{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay WAL at %q: %w", opts.WALDir, err)
+		}
+		for _, rec := range records {
+			switch rec.Kind {
+			case wal.RecordKindFlow:
+				s.writeRing(&v1.Event{Timestamp: rec.Flow.GetTime(), Event: rec.Flow})
+			case wal.RecordKindAgentEvent:
+				s.writeRing(&v1.Event{Timestamp: timestamppb.New(rec.Timestamp), Event: rec.AgentEvent})
+			}
+		}
+	}
+
+	for _, onServerInit := range s.opts.OnServerInit {
+		if err := onServerInit.OnServerInit(s); err != nil {
+			s.logger.WithError(err).Error("failed in OnServerInit")
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Start implements service.Service: it starts a goroutine that processes
+// events sent to the events channel until ctx is cancelled or the events
+// channel is closed, whichever happens first.
+func (s *LocalObserverServer) Start(ctx context.Context) error {
+	return s.BaseService.Run(ctx, s.run)
+}
+
+// run is the server's event processing loop; see Start.
+func (s *LocalObserverServer) run(ctx context.Context) {
+	for {
+		var monitorEvent *observerTypes.MonitorEvent
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-s.GetEventsChannel():
+			if !ok {
+				return
+			}
+			monitorEvent = ev
+		}
+
+		if stop, err := s.runOnMonitorEventHooks(ctx, monitorEvent); err != nil {
+			s.logger.WithError(err).Error("failed in OnMonitorEvent")
+			continue
+		} else if stop {
+			continue
+		}
+
+		switch payload := monitorEvent.Payload.(type) {
+		case *observerTypes.PerfEvent:
+			decoded := &flowpb.Flow{}
+			if err := s.GetPayloadParser().Decode(monitorEvent, decoded); err != nil {
+				s.logger.WithError(err).Debug("failed to decode flow")
+				continue
+			}
+
+			if stop, err := s.runOnDecodedFlowHooks(ctx, decoded); err != nil {
+				s.logger.WithError(err).Error("failed in OnDecodedFlow")
+				continue
+			} else if stop {
+				continue
+			}
+
+			if s.wal != nil {
+				if err := s.wal.Append(&wal.Record{Timestamp: decoded.GetTime().AsTime(), Kind: wal.RecordKindFlow, Flow: decoded}); err != nil {
+					s.logger.WithError(err).Error("failed to append flow to WAL")
+				}
+			}
+			s.writeRing(&v1.Event{Timestamp: decoded.GetTime(), Event: decoded})
+		case *observerTypes.AgentEvent:
+			ts := timestamppb.New(monitorEvent.Timestamp.UTC())
+			agentEventProto := payload.ToProto()
+			if s.wal != nil {
+				if err := s.wal.Append(&wal.Record{Timestamp: ts.AsTime(), Kind: wal.RecordKindAgentEvent, AgentEvent: agentEventProto}); err != nil {
+					s.logger.WithError(err).Error("failed to append agent event to WAL")
+				}
+			}
+			s.writeRing(&v1.Event{Timestamp: ts, Event: payload})
+		case *observerTypes.DebugEvent:
+			s.writeRing(&v1.Event{Timestamp: timestamppb.New(monitorEvent.Timestamp.UTC()), Event: payload})
+		default:
+			s.logger.WithField("payload", payload).Warn("discarded unknown payload")
+			continue
+		}
+
+		atomic.AddUint64(&s.numObservedFlows, 1)
+	}
+}
+
+// GetEventsChannel returns the event channel to receive events from.
+func (s *LocalObserverServer) GetEventsChannel() chan *observerTypes.MonitorEvent {
+	return s.eventschan
+}
+
+// GetRingBuffer returns the underlying ring buffer that the server is
+// backed by.
+func (s *LocalObserverServer) GetRingBuffer() *container.Ring {
+	return s.ring
+}
+
+// writeRing writes ev to the ring buffer and records its timestamp in
+// s.ringWindow, which tracks the oldest timestamp the ring currently holds.
+func (s *LocalObserverServer) writeRing(ev *v1.Event) {
+	s.ring.Write(ev)
+	s.ringWindow.record(ev.Timestamp.AsTime())
+}
+
+// oldestRingTimestamp returns the timestamp of the oldest flow or event
+// currently held in the ring buffer, or the zero time if the ring is empty.
+func (s *LocalObserverServer) oldestRingTimestamp() time.Time {
+	return s.ringWindow.oldest()
+}
+
+// GetPayloadParser returns the parser.Parser used to decode flows.
+func (s *LocalObserverServer) GetPayloadParser() *parser.Parser {
+	return s.payloadParser
+}
+
+// GetLogger returns the logger assigned to this server.
+func (s *LocalObserverServer) GetLogger() *logrus.Logger {
+	return s.logger
+}
+
+// GetStopped returns a channel that is closed once the server has stopped
+// processing events (i.e. once its events channel has been closed and
+// drained, or its context was cancelled). It is kept as a thin wrapper over
+// the service.Service-standard Wait for backwards compatibility with
+// existing callers.
+func (s *LocalObserverServer) GetStopped() <-chan struct{} {
+	return s.Wait()
+}
+
+// GetOptions returns the options the server was configured with, as required
+// by the observeroption.Server interface.
+func (s *LocalObserverServer) GetOptions() observeroption.Options {
+	return s.opts
+}
+
+// ServerStatus returns some details about the running hubble server.
+func (s *LocalObserverServer) ServerStatus(_ context.Context, _ *observerpb.ServerStatusRequest) (*observerpb.ServerStatusResponse, error) {
+	return &observerpb.ServerStatusResponse{
+		Version:   "",
+		NumFlows:  s.GetRingBuffer().Len(),
+		MaxFlows:  s.GetRingBuffer().Cap(),
+		SeenFlows: atomic.LoadUint64(&s.numObservedFlows),
+		UptimeNs:  uint64(time.Since(s.startTime).Nanoseconds()),
+	}, nil
+}
+
+// WALStatus returns the number of segments, total bytes on disk, and oldest
+// retained record timestamp of the server's write-ahead log. It is not part
+// of observerpb.ServerStatusResponse, which this series does not regenerate,
+// so callers that need WAL details use this directly rather than going
+// through ServerStatus. ok is false if the server was not configured with
+// observeroption.WithWAL.
+func (s *LocalObserverServer) WALStatus() (segments int, bytes int64, oldest time.Time, ok bool) {
+	if s.wal == nil {
+		return 0, 0, time.Time{}, false
+	}
+	segments, bytes, oldest = s.wal.Status()
+	return segments, bytes, oldest, true
+}
+
+// GetFlows implements the streaming gRPC method to fetch flows from the
+// ring buffer, optionally following as new flows arrive.
+func (s *LocalObserverServer) GetFlows(req *observerpb.GetFlowsRequest, server observerpb.Observer_GetFlowsServer) (err error) {
+	ctx := server.Context()
+	for _, onGetFlows := range s.opts.OnGetFlows {
+		if ctx, err = onGetFlows.OnGetFlows(ctx, req); err != nil {
+			return err
+		}
+	}
+
+	ring := s.GetRingBuffer()
+	reader := container.NewRingReader(ring, ring.LastWriteParallel())
+
+	streamCtx := ctx
+	var detector *streamStallDetector
+	if req.GetFollow() {
+		if detector = newStreamStallDetector(s.opts.StreamStallDetector); detector != nil {
+			var cancel context.CancelFunc
+			streamCtx, cancel = context.WithCancel(ctx)
+			defer cancel()
+			go detector.watch(streamCtx, cancel)
+		}
+	}
+
+	var numFlows uint64
+	if s.wal != nil && req.GetSince() != nil {
+		n, err := s.stitchWALFlows(ctx, req, server, s.oldestRingTimestamp())
+		if err != nil {
+			return err
+		}
+		numFlows += n
+		if req.GetNumber() != 0 && numFlows >= req.GetNumber() {
+			return nil
+		}
+	}
+
+	for ; ; reader.Previous() {
+		event, err := reader.Next(streamCtx)
+		if err != nil {
+			if detector.terminate() && detector.isStalled() {
+				return errStreamStalled
+			}
+			if err == io.EOF && !req.GetFollow() {
+				return nil
+			}
+			return err
+		}
+
+		if detector != nil {
+			detector.markBufferHead(event.Timestamp.AsTime())
+		}
+
+		flow, ok := event.Event.(*flowpb.Flow)
+		if !ok {
+			continue
+		}
+		if req.GetSince() != nil && event.Timestamp.AsTime().Before(req.GetSince().AsTime()) {
+			continue
+		}
+
+		if stop, err := s.runOnFlowDeliveryHooks(ctx, flow); err != nil {
+			return err
+		} else if stop {
+			continue
+		}
+
+		resp := &observerpb.GetFlowsResponse{
+			Time:     flow.GetTime(),
+			NodeName: flow.GetNodeName(),
+			ResponseTypes: &observerpb.GetFlowsResponse_Flow{
+				Flow: flow,
+			},
+		}
+		if err := server.Send(resp); err != nil {
+			return err
+		}
+		if detector != nil {
+			detector.markDelivered(flow.GetTime().AsTime())
+		}
+
+		numFlows++
+		if req.GetNumber() != 0 && numFlows >= req.GetNumber() {
+			return nil
+		}
+	}
+}
+
+// GetAgentEvents implements the streaming gRPC method to fetch agent events
+// from the ring buffer.
+func (s *LocalObserverServer) GetAgentEvents(req *observerpb.GetAgentEventsRequest, server observerpb.Observer_GetAgentEventsServer) error {
+	ctx := server.Context()
+	ring := s.GetRingBuffer()
+	reader := container.NewRingReader(ring, ring.LastWriteParallel())
+
+	streamCtx := ctx
+	var detector *streamStallDetector
+	if req.GetFollow() {
+		if detector = newStreamStallDetector(s.opts.StreamStallDetector); detector != nil {
+			var cancel context.CancelFunc
+			streamCtx, cancel = context.WithCancel(ctx)
+			defer cancel()
+			go detector.watch(streamCtx, cancel)
+		}
+	}
+
+	var numEvents uint64
+	for ; ; reader.Previous() {
+		event, err := reader.Next(streamCtx)
+		if err != nil {
+			if detector.terminate() && detector.isStalled() {
+				return errStreamStalled
+			}
+			if err == io.EOF && !req.GetFollow() {
+				return nil
+			}
+			return err
+		}
+
+		if detector != nil {
+			detector.markBufferHead(event.Timestamp.AsTime())
+		}
+
+		// Live agent events arrive as *observerTypes.AgentEvent; ones
+		// replayed from the WAL on startup are already the marshaled
+		// *flowpb.AgentEvent that was written to disk. Accept both rather
+		// than forcing the WAL replay path to reconstruct the former from
+		// the latter.
+		var agentEventProto *flowpb.AgentEvent
+		switch ev := event.Event.(type) {
+		case *observerTypes.AgentEvent:
+			agentEventProto = ev.ToProto()
+		case *flowpb.AgentEvent:
+			agentEventProto = ev
+		default:
+			continue
+		}
+
+		resp := &observerpb.GetAgentEventsResponse{
+			Time:       event.Timestamp,
+			AgentEvent: agentEventProto,
+		}
+		if err := server.Send(resp); err != nil {
+			return err
+		}
+		if detector != nil {
+			detector.markDelivered(event.Timestamp.AsTime())
+		}
+
+		numEvents++
+		if req.GetNumber() != 0 && numEvents >= req.GetNumber() {
+			return nil
+		}
+	}
+}
+
+// stitchWALFlows replays WAL flows in [req.GetSince(), ringOldest) and sends
+// them to server ahead of the ring buffer's own contents, so that a Since
+// older than what the ring currently holds transparently spans the WAL/ring
+// boundary. It returns the number of flows sent. A zero ringOldest (an empty
+// ring) means every matching WAL record is sent.
+func (s *LocalObserverServer) stitchWALFlows(ctx context.Context, req *observerpb.GetFlowsRequest, server observerpb.Observer_GetFlowsServer, ringOldest time.Time) (uint64, error) {
+	records, err := s.wal.Replay(req.GetSince().AsTime())
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay WAL: %w", err)
+	}
+
+	var sent uint64
+	for _, rec := range records {
+		if rec.Kind != wal.RecordKindFlow {
+			continue
+		}
+		if !ringOldest.IsZero() && !rec.Timestamp.Before(ringOldest) {
+			// this and everything after it (records are ordered oldest
+			// first) is already covered by the ring buffer.
+			break
+		}
+
+		if stop, err := s.runOnFlowDeliveryHooks(ctx, rec.Flow); err != nil {
+			return sent, err
+		} else if stop {
+			continue
+		}
+
+		resp := &observerpb.GetFlowsResponse{
+			Time:     rec.Flow.GetTime(),
+			NodeName: rec.Flow.GetNodeName(),
+			ResponseTypes: &observerpb.GetFlowsResponse_Flow{
+				Flow: rec.Flow,
+			},
+		}
+		if err := server.Send(resp); err != nil {
+			return sent, err
+		}
+
+		sent++
+		if req.GetNumber() != 0 && sent >= req.GetNumber() {
+			return sent, nil
+		}
+	}
+	return sent, nil
+}
+
+func (s *LocalObserverServer) runOnMonitorEventHooks(ctx context.Context, event *observerTypes.MonitorEvent) (bool, error) {
+	for _, hook := range s.opts.OnMonitorEvent {
+		stop, err := hook.OnMonitorEvent(ctx, event)
+		if err != nil || stop {
+			return stop, err
+		}
+	}
+	return false, nil
+}
+
+func (s *LocalObserverServer) runOnDecodedFlowHooks(ctx context.Context, flow *flowpb.Flow) (bool, error) {
+	for _, hook := range s.opts.OnDecodedFlow {
+		stop, err := hook.OnDecodedFlow(ctx, flow)
+		if err != nil || stop {
+			return stop, err
+		}
+	}
+	return false, nil
+}
+
+func (s *LocalObserverServer) runOnFlowDeliveryHooks(ctx context.Context, flow *flowpb.Flow) (bool, error) {
+	for _, hook := range s.opts.OnFlowDelivery {
+		stop, err := hook.OnFlowDelivery(ctx, flow)
+		if err != nil || stop {
+			return stop, err
+		}
+	}
+	return false, nil
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,6 +26,7 @@ import (
 	"github.com/cilium/cilium/pkg/hubble/container"
 	"github.com/cilium/cilium/pkg/hubble/observer/observeroption"
 	observerTypes "github.com/cilium/cilium/pkg/hubble/observer/types"
+	"github.com/cilium/cilium/pkg/hubble/observer/wal"
 	"github.com/cilium/cilium/pkg/hubble/parser"
 	"github.com/cilium/cilium/pkg/hubble/testutils"
 	"github.com/cilium/cilium/pkg/monitor"
@@ -99,7 +101,7 @@ func TestLocalObserverServer_GetFlows(t *testing.T) {
 		observeroption.WithMonitorBuffer(queueSize),
 	)
 	require.NoError(t, err)
-	go s.Start()
+	require.NoError(t, s.Start(context.Background()))
 
 	m := s.GetEventsChannel()
 	for i := 0; i < numFlows; i++ {
@@ -164,7 +166,7 @@ func TestLocalObserverServer_GetAgentEvents(t *testing.T) {
 		observeroption.WithMonitorBuffer(queueSize),
 	)
 	require.NoError(t, err)
-	go s.Start()
+	require.NoError(t, s.Start(context.Background()))
 
 	m := s.GetEventsChannel()
 	for i := 0; i < numEvents; i++ {
@@ -198,6 +200,66 @@ func TestLocalObserverServer_GetAgentEvents(t *testing.T) {
 	assert.Greater(t, agentEventsReceived, 0)
 }
 
+// TestLocalObserverServer_GetAgentEvents_WALReplay covers agent events that
+// reach GetAgentEvents only via WAL replay, rather than the live run loop:
+// it writes agent events through one server, then opens a second server
+// against the same WAL directory (the same "resume after restart" path
+// NewLocalServer always takes) and confirms GetAgentEvents can still type
+// assert and deliver them.
+func TestLocalObserverServer_GetAgentEvents_WALReplay(t *testing.T) {
+	walDir := t.TempDir()
+	numEvents := 5
+	cidr := "10.0.0.0/8"
+
+	pp := noopParser(t)
+	s1, err := NewLocalServer(pp, log,
+		observeroption.WithMaxFlows(container.Capacity1),
+		observeroption.WithWAL(walDir, wal.Default),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s1.Start(context.Background()))
+
+	m := s1.GetEventsChannel()
+	for i := 0; i < numEvents; i++ {
+		m <- &observerTypes.MonitorEvent{
+			Timestamp: time.Unix(int64(i), 0),
+			NodeName:  fmt.Sprintf("node #%03d", i),
+			Payload: &observerTypes.AgentEvent{
+				Type:    monitorAPI.MessageTypeAgent,
+				Message: monitorAPI.IPCacheUpsertedMessage(cidr, uint32(i), nil, net.ParseIP("10.1.5.4"), nil, 0xff, "default", "foobar"),
+			},
+		}
+	}
+	close(m)
+	<-s1.GetStopped()
+
+	s2, err := NewLocalServer(pp, log,
+		observeroption.WithMaxFlows(container.Capacity1),
+		observeroption.WithWAL(walDir, wal.Default),
+	)
+	require.NoError(t, err)
+
+	received := 0
+	req := &observerpb.GetAgentEventsRequest{Number: uint64(numEvents)}
+	fakeServer := &testutils.FakeGetAgentEventsServer{
+		OnSend: func(response *observerpb.GetAgentEventsResponse) error {
+			assert.Equal(t, flowpb.AgentEventType_IPCACHE_UPSERTED, response.GetAgentEvent().GetType())
+			ipcacheUpdate := response.GetAgentEvent().GetIpcacheUpdate()
+			assert.NotNil(t, ipcacheUpdate)
+			assert.Equal(t, cidr, ipcacheUpdate.GetCidr())
+			received++
+			return nil
+		},
+		FakeGRPCServerStream: &testutils.FakeGRPCServerStream{
+			OnContext: func() context.Context {
+				return context.Background()
+			},
+		},
+	}
+	require.NoError(t, s2.GetAgentEvents(req, fakeServer))
+	assert.Greater(t, received, 0, "agent events replayed from the WAL must still be deliverable via GetAgentEvents")
+}
+
 func TestLocalObserverServer_GetFlows_Follow_Since(t *testing.T) {
 	numFlows := 100
 	queueSize := 0
@@ -216,7 +278,7 @@ func TestLocalObserverServer_GetFlows_Follow_Since(t *testing.T) {
 		observeroption.WithMonitorBuffer(queueSize),
 	)
 	require.NoError(t, err)
-	go s.Start()
+	require.NoError(t, s.Start(context.Background()))
 
 	generateFlows := func(from, to int, m chan<- *observerTypes.MonitorEvent) {
 		for i := from; i < to; i++ {
@@ -280,6 +342,224 @@ func TestLocalObserverServer_GetFlows_Follow_Since(t *testing.T) {
 	assert.Equal(t, err, io.EOF)
 }
 
+// TestLocalObserverServer_GetFlows_Follow_Stall follows the setup of
+// TestLocalObserverServer_GetFlows_Follow_Since, but halts delivery part way
+// ("producer keeps going, delivery halts") and drives it through a real GetFlows(Follow: true)
+// call with a WithStreamStallDetector configured, instead of unit-testing
+// streamStallDetector in isolation. The flows are already fully buffered
+// before the Follow request starts, so as soon as the subscriber's OnSend
+// blocks for longer than the stall window, the buffer is "ahead" of what
+// has been delivered and a stall must be reported; once OnSend starts
+// returning promptly again, the subscription must be reported as resumed.
+func TestLocalObserverServer_GetFlows_Follow_Stall(t *testing.T) {
+	numFlows := 20
+	queueSize := 0
+
+	var mu sync.Mutex
+	var stalls, resumes int
+
+	onStall := func(_ context.Context, _ uint64, lastDelivered, headOfBuffer time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		stalls++
+		assert.True(t, headOfBuffer.After(lastDelivered))
+	}
+	onResume := func(_ context.Context, _ uint64) {
+		mu.Lock()
+		defer mu.Unlock()
+		resumes++
+	}
+
+	pp := noopParser(t)
+	s, err := NewLocalServer(pp, log,
+		observeroption.WithMaxFlows(container.Capacity127),
+		observeroption.WithMonitorBuffer(queueSize),
+		observeroption.WithStreamStallDetector(20*time.Millisecond, onStall, onResume, false),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Start(context.Background()))
+
+	m := s.GetEventsChannel()
+	for i := 0; i < numFlows; i++ {
+		tn := monitor.TraceNotifyV0{Type: byte(monitorAPI.MessageTypeTrace)}
+		data := testutils.MustCreateL3L4Payload(tn)
+		m <- &observerTypes.MonitorEvent{
+			Timestamp: time.Unix(int64(i), 0),
+			NodeName:  fmt.Sprintf("node #%03d", i),
+			Payload: &observerTypes.PerfEvent{
+				Data: data,
+				CPU:  0,
+			},
+		}
+	}
+	close(m)
+	<-s.GetStopped()
+
+	received := 0
+	fakeServer := &testutils.FakeGetFlowsServer{
+		OnSend: func(response *observerpb.GetFlowsResponse) error {
+			received++
+			if received == numFlows/2 {
+				// halt delivery long enough for the already-buffered flows
+				// ahead of us to exceed the stall window.
+				time.Sleep(100 * time.Millisecond)
+			}
+			if received == numFlows {
+				return io.EOF
+			}
+			return nil
+		},
+		FakeGRPCServerStream: &testutils.FakeGRPCServerStream{
+			OnContext: func() context.Context {
+				return context.Background()
+			},
+		},
+	}
+
+	req := &observerpb.GetFlowsRequest{Follow: true}
+	err = s.GetFlows(req, fakeServer)
+	assert.Equal(t, io.EOF, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, stalls, 0, "a subscriber that stops delivering must be reported as stalled")
+	assert.Greater(t, resumes, 0, "delivery catching back up must be reported as resumed")
+}
+
+// TestLocalObserverServer_GetAgentEvents_Follow_Stall mirrors
+// TestLocalObserverServer_GetFlows_Follow_Stall for GetAgentEvents, since
+// WithStreamStallDetector promises to cover Follow subscriptions on both
+// RPCs.
+func TestLocalObserverServer_GetAgentEvents_Follow_Stall(t *testing.T) {
+	numEvents := 20
+	queueSize := 0
+
+	var mu sync.Mutex
+	var stalls, resumes int
+
+	onStall := func(_ context.Context, _ uint64, lastDelivered, headOfBuffer time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		stalls++
+		assert.True(t, headOfBuffer.After(lastDelivered))
+	}
+	onResume := func(_ context.Context, _ uint64) {
+		mu.Lock()
+		defer mu.Unlock()
+		resumes++
+	}
+
+	pp := noopParser(t)
+	s, err := NewLocalServer(pp, log,
+		observeroption.WithMaxFlows(container.Capacity127),
+		observeroption.WithMonitorBuffer(queueSize),
+		observeroption.WithStreamStallDetector(20*time.Millisecond, onStall, onResume, false),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Start(context.Background()))
+
+	m := s.GetEventsChannel()
+	for i := 0; i < numEvents; i++ {
+		m <- &observerTypes.MonitorEvent{
+			Timestamp: time.Unix(int64(i), 0),
+			NodeName:  fmt.Sprintf("node #%03d", i),
+			Payload: &observerTypes.AgentEvent{
+				Type:    monitorAPI.MessageTypeAgent,
+				Message: monitorAPI.ServiceDeleteMessage(uint32(i)),
+			},
+		}
+	}
+	close(m)
+	<-s.GetStopped()
+
+	received := 0
+	fakeServer := &testutils.FakeGetAgentEventsServer{
+		OnSend: func(response *observerpb.GetAgentEventsResponse) error {
+			received++
+			if received == numEvents/2 {
+				// halt delivery long enough for the already-buffered events
+				// ahead of us to exceed the stall window.
+				time.Sleep(100 * time.Millisecond)
+			}
+			if received == numEvents {
+				return io.EOF
+			}
+			return nil
+		},
+		FakeGRPCServerStream: &testutils.FakeGRPCServerStream{
+			OnContext: func() context.Context {
+				return context.Background()
+			},
+		},
+	}
+
+	req := &observerpb.GetAgentEventsRequest{Follow: true}
+	err = s.GetAgentEvents(req, fakeServer)
+	assert.Equal(t, io.EOF, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, stalls, 0, "a subscriber that stops delivering must be reported as stalled")
+	assert.Greater(t, resumes, 0, "delivery catching back up must be reported as resumed")
+}
+
+// TestLocalObserverServer_GetFlows_Since_SpansWALBoundary exercises a Since
+// query older than the ring buffer's oldest flow against a server backed by
+// a real, on-disk WAL: the ring's tiny capacity means most flows have
+// already been evicted from memory by the time the request runs, so only
+// stitchWALFlows reaching back into the WAL can account for all of them.
+func TestLocalObserverServer_GetFlows_Since_SpansWALBoundary(t *testing.T) {
+	numFlows := 20
+
+	pp := noopParser(t)
+	s, err := NewLocalServer(pp, log,
+		observeroption.WithMaxFlows(container.Capacity1),
+		observeroption.WithWAL(t.TempDir(), wal.Default),
+	)
+	require.NoError(t, err)
+	require.NoError(t, s.Start(context.Background()))
+
+	m := s.GetEventsChannel()
+	for i := 0; i < numFlows; i++ {
+		tn := monitor.TraceNotifyV0{Type: byte(monitorAPI.MessageTypeTrace)}
+		data := testutils.MustCreateL3L4Payload(tn)
+		m <- &observerTypes.MonitorEvent{
+			Timestamp: time.Unix(int64(i), 0),
+			NodeName:  fmt.Sprintf("node #%03d", i),
+			Payload: &observerTypes.PerfEvent{
+				Data: data,
+				CPU:  0,
+			},
+		}
+	}
+	close(m)
+	<-s.GetStopped()
+
+	require.Less(t, s.GetRingBuffer().Len(), uint64(numFlows),
+		"test is only meaningful if the ring's capacity forced eviction of older flows")
+
+	seen := make(map[int64]bool)
+	fakeServer := &testutils.FakeGetFlowsServer{
+		OnSend: func(response *observerpb.GetFlowsResponse) error {
+			seen[response.GetTime().AsTime().Unix()] = true
+			return nil
+		},
+		FakeGRPCServerStream: &testutils.FakeGRPCServerStream{
+			OnContext: func() context.Context {
+				return context.Background()
+			},
+		},
+	}
+
+	req := &observerpb.GetFlowsRequest{Since: timestamppb.New(time.Unix(0, 0))}
+	require.NoError(t, s.GetFlows(req, fakeServer))
+
+	assert.Len(t, seen, numFlows, "Since older than the ring's oldest flow must be stitched together from the WAL")
+	for i := 0; i < numFlows; i++ {
+		assert.True(t, seen[int64(i)], "missing flow with timestamp %d", i)
+	}
+}
+
 type fakeCiliumDaemon struct{}
 
 func (f *fakeCiliumDaemon) DebugEnabled() bool {
@@ -335,7 +615,7 @@ func TestHooks(t *testing.T) {
 		observeroption.WithOnDecodedFlowFunc(onDecodedFlow),
 	)
 	require.NoError(t, err)
-	go s.Start()
+	require.NoError(t, s.Start(context.Background()))
 
 	m := s.GetEventsChannel()
 	for i := 0; i < numFlows; i++ {
@@ -390,7 +670,7 @@ func TestLocalObserverServer_OnFlowDelivery(t *testing.T) {
 		observeroption.WithOnFlowDeliveryFunc(onFlowDelivery),
 	)
 	require.NoError(t, err)
-	go s.Start()
+	require.NoError(t, s.Start(context.Background()))
 
 	m := s.GetEventsChannel()
 	for i := 0; i < numFlows; i++ {
@@ -454,7 +734,7 @@ func TestLocalObserverServer_OnGetFlows(t *testing.T) {
 		observeroption.WithOnGetFlowsFunc(onGetFlows),
 	)
 	require.NoError(t, err)
-	go s.Start()
+	require.NoError(t, s.Start(context.Background()))
 
 	m := s.GetEventsChannel()
 	for i := 0; i < numFlows; i++ {
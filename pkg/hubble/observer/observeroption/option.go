@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+// Package observeroption defines the functional options used to configure
+// Hubble's observer servers (see pkg/hubble/observer).
+package observeroption
+
+import (
+	"context"
+
+	"k8s.io/client-go/tools/cache"
+
+	flowpb "github.com/cilium/cilium/api/v1/flow"
+	observerpb "github.com/cilium/cilium/api/v1/observer"
+	"github.com/cilium/cilium/pkg/hubble/container"
+	observerTypes "github.com/cilium/cilium/pkg/hubble/observer/types"
+	"github.com/cilium/cilium/pkg/hubble/observer/wal"
+)
+
+// Server is the interface exposed by observer servers to their hooks. It
+// allows hooks to reach back into the server that invoked them without
+// requiring a hard dependency between the observeroption and observer
+// packages.
+type Server interface {
+	GetOptions() Options
+}
+
+// CiliumDaemon is the subset of the Cilium daemon state that observer hooks
+// may need access to (for example to look up debug settings or read from a
+// k8s shared informer store).
+type CiliumDaemon interface {
+	DebugEnabled() bool
+	GetK8sStore(name string) cache.Store
+}
+
+// OnServerInit is invoked once, after an observer server has finished
+// initializing but before it starts processing events.
+type OnServerInit interface {
+	OnServerInit(Server) error
+}
+
+// OnServerInitFunc implements OnServerInit for a single function.
+type OnServerInitFunc func(Server) error
+
+// OnServerInit implements OnServerInit.
+func (f OnServerInitFunc) OnServerInit(s Server) error {
+	return f(s)
+}
+
+// OnMonitorEvent is invoked on every event coming from the monitor, before
+// it is decoded. Returning true stops further processing of the event.
+type OnMonitorEvent interface {
+	OnMonitorEvent(context.Context, *observerTypes.MonitorEvent) (stop bool, err error)
+}
+
+// OnMonitorEventFunc implements OnMonitorEvent for a single function.
+type OnMonitorEventFunc func(context.Context, *observerTypes.MonitorEvent) (bool, error)
+
+// OnMonitorEvent implements OnMonitorEvent.
+func (f OnMonitorEventFunc) OnMonitorEvent(ctx context.Context, event *observerTypes.MonitorEvent) (bool, error) {
+	return f(ctx, event)
+}
+
+// OnDecodedFlow is invoked on every flow, after it has been decoded but
+// before it is written to the ring buffer. Returning true stops further
+// processing of the flow.
+type OnDecodedFlow interface {
+	OnDecodedFlow(context.Context, *flowpb.Flow) (stop bool, err error)
+}
+
+// OnDecodedFlowFunc implements OnDecodedFlow for a single function.
+type OnDecodedFlowFunc func(context.Context, *flowpb.Flow) (bool, error)
+
+// OnDecodedFlow implements OnDecodedFlow.
+func (f OnDecodedFlowFunc) OnDecodedFlow(ctx context.Context, flow *flowpb.Flow) (bool, error) {
+	return f(ctx, flow)
+}
+
+// OnFlowDelivery is invoked for every flow that is about to be sent to a
+// GetFlows subscriber. Returning true skips delivery of that flow to this
+// particular subscriber.
+type OnFlowDelivery interface {
+	OnFlowDelivery(context.Context, *flowpb.Flow) (stop bool, err error)
+}
+
+// OnFlowDeliveryFunc implements OnFlowDelivery for a single function.
+type OnFlowDeliveryFunc func(context.Context, *flowpb.Flow) (bool, error)
+
+// OnFlowDelivery implements OnFlowDelivery.
+func (f OnFlowDeliveryFunc) OnFlowDelivery(ctx context.Context, flow *flowpb.Flow) (bool, error) {
+	return f(ctx, flow)
+}
+
+// OnGetFlows is invoked at the start of a GetFlows call and may enrich the
+// context that is threaded through the remainder of the request.
+type OnGetFlows interface {
+	OnGetFlows(context.Context, *observerpb.GetFlowsRequest) (context.Context, error)
+}
+
+// OnGetFlowsFunc implements OnGetFlows for a single function.
+type OnGetFlowsFunc func(context.Context, *observerpb.GetFlowsRequest) (context.Context, error)
+
+// OnGetFlows implements OnGetFlows.
+func (f OnGetFlowsFunc) OnGetFlows(ctx context.Context, req *observerpb.GetFlowsRequest) (context.Context, error) {
+	return f(ctx, req)
+}
+
+// Options stores all the configurable options of an observer server.
+//
+// Hooks that can be registered more than once (OnMonitorEvent,
+// OnDecodedFlow, OnFlowDelivery, OnGetFlows) are stored as slices and run in
+// registration order; the first one that requests a stop short-circuits the
+// rest.
+type Options struct {
+	MaxFlows      container.Capacity
+	MonitorBuffer int
+	CiliumDaemon  CiliumDaemon
+
+	OnServerInit        []OnServerInit
+	OnMonitorEvent      []OnMonitorEvent
+	OnDecodedFlow       []OnDecodedFlow
+	OnFlowDelivery      []OnFlowDelivery
+	OnGetFlows          []OnGetFlows
+	StreamStallDetector *StreamStallDetectorConfig
+
+	// WALDir, if non-empty, enables the persistent write-ahead log and
+	// names the directory its segments are stored in. See WithWAL.
+	WALDir     string
+	WALOptions wal.Options
+}
+
+// Default is the default set of options for an observer server.
+var Default = Options{
+	MaxFlows:      container.Capacity15,
+	MonitorBuffer: 1024,
+}
+
+// Option is a functional option that mutates an observer server's Options.
+type Option func(o *Options) error
+
+// WithMaxFlows sets the capacity of the flows ring buffer.
+func WithMaxFlows(capacity container.Capacity) Option {
+	return func(o *Options) error {
+		o.MaxFlows = capacity
+		return nil
+	}
+}
+
+// WithMonitorBuffer sets the size of the buffered channel used to receive
+// monitor events.
+func WithMonitorBuffer(size int) Option {
+	return func(o *Options) error {
+		o.MonitorBuffer = size
+		return nil
+	}
+}
+
+// WithCiliumDaemon configures access to the running Cilium daemon.
+func WithCiliumDaemon(d CiliumDaemon) Option {
+	return func(o *Options) error {
+		o.CiliumDaemon = d
+		return nil
+	}
+}
+
+// WithOnServerInitFunc configures a function to be run when the server
+// starts.
+func WithOnServerInitFunc(f func(Server) error) Option {
+	return func(o *Options) error {
+		o.OnServerInit = append(o.OnServerInit, OnServerInitFunc(f))
+		return nil
+	}
+}
+
+// WithOnMonitorEventFunc configures a function to be run for every monitor
+// event received by the server.
+func WithOnMonitorEventFunc(f func(context.Context, *observerTypes.MonitorEvent) (bool, error)) Option {
+	return func(o *Options) error {
+		o.OnMonitorEvent = append(o.OnMonitorEvent, OnMonitorEventFunc(f))
+		return nil
+	}
+}
+
+// WithOnDecodedFlowFunc configures a function to be run for every decoded
+// flow, before it is written to the ring buffer.
+func WithOnDecodedFlowFunc(f func(context.Context, *flowpb.Flow) (bool, error)) Option {
+	return func(o *Options) error {
+		o.OnDecodedFlow = append(o.OnDecodedFlow, OnDecodedFlowFunc(f))
+		return nil
+	}
+}
+
+// WithOnFlowDeliveryFunc configures a function to be run for every flow
+// about to be sent to a GetFlows subscriber.
+func WithOnFlowDeliveryFunc(f func(context.Context, *flowpb.Flow) (bool, error)) Option {
+	return func(o *Options) error {
+		o.OnFlowDelivery = append(o.OnFlowDelivery, OnFlowDeliveryFunc(f))
+		return nil
+	}
+}
+
+// WithOnGetFlowsFunc configures a function to be run at the start of every
+// GetFlows call.
+func WithOnGetFlowsFunc(f func(context.Context, *observerpb.GetFlowsRequest) (context.Context, error)) Option {
+	return func(o *Options) error {
+		o.OnGetFlows = append(o.OnGetFlows, OnGetFlowsFunc(f))
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+package observeroption
+
+import (
+	"context"
+	"time"
+)
+
+// OnStallFunc is invoked when delivery on a Follow subscription falls behind
+// the newest event that subscription has read from the ring buffer by more
+// than the configured stall window.
+type OnStallFunc func(ctx context.Context, subscriptionID uint64, lastDelivered, headOfBuffer time.Time)
+
+// OnResumeFunc is invoked once a previously stalled subscription has caught
+// back up with the head of the ring buffer.
+type OnResumeFunc func(ctx context.Context, subscriptionID uint64)
+
+// StreamStallDetectorConfig configures the stall detector installed on
+// Follow subscriptions by WithStreamStallDetector.
+type StreamStallDetectorConfig struct {
+	// Window is the maximum gap, in event timestamps, between the newest
+	// event a Follow subscription has read from the ring buffer and the last
+	// event it delivered, before it is considered stalled.
+	Window time.Duration
+	// OnStall is invoked when a subscription stalls.
+	OnStall OnStallFunc
+	// OnResume is invoked when a stalled subscription catches back up.
+	OnResume OnResumeFunc
+	// TerminateOnStall closes the stream with a distinct gRPC status as
+	// soon as a stall is detected, instead of only notifying OnStall.
+	TerminateOnStall bool
+}
+
+// WithStreamStallDetector installs a stall detector on every Follow
+// subscription (GetFlows and GetAgentEvents with Follow: true). The detector
+// mirrors the timestamp of the last event a subscription actually delivered
+// against the timestamp of the newest event that subscription has read from
+// the ring buffer; if delivery falls behind by more than window, OnStall is
+// invoked with the subscription's id and the two timestamps, so that callers
+// such as Relay or the CLI can tell a session that is hung on filter
+// evaluation or gRPC backpressure apart from one silently sitting idle.
+// Events admitted to the ring buffer that the subscription has not read yet
+// are not counted. OnResume fires once delivery has caught back up.
+func WithStreamStallDetector(window time.Duration, onStall OnStallFunc, onResume OnResumeFunc, terminateOnStall bool) Option {
+	return func(o *Options) error {
+		o.StreamStallDetector = &StreamStallDetectorConfig{
+			Window:           window,
+			OnStall:          onStall,
+			OnResume:         onResume,
+			TerminateOnStall: terminateOnStall,
+		}
+		return nil
+	}
+}
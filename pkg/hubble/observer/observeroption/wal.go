@@ -0,0 +1,20 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+package observeroption
+
+import (
+	"github.com/cilium/cilium/pkg/hubble/observer/wal"
+)
+
+// WithWAL configures the server to mirror every accepted flow and agent
+// event into a persistent, segmented write-ahead log rooted at dir before
+// it enters the in-memory ring buffer, and to replay the tail of that log
+// back into the ring on startup so recent flows survive an agent restart.
+func WithWAL(dir string, opts wal.Options) Option {
+	return func(o *Options) error {
+		o.WALDir = dir
+		o.WALOptions = opts
+		return nil
+	}
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+package observer
+
+import (
+	"sync"
+	"time"
+)
+
+// ringWindow tracks the timestamp of the oldest entry currently held in a
+// fixed-capacity ring buffer. container.Ring exposes no such accessor
+// itself, so LocalObserverServer mirrors the ring's own overwrite behavior
+// here: every timestamp written to the ring is also recorded in a
+// same-capacity circular buffer of timestamps, from which the oldest one can
+// be read back cheaply.
+type ringWindow struct {
+	mu    sync.Mutex
+	ts    []time.Time
+	next  int
+	count int
+}
+
+// newRingWindow returns a ringWindow sized to capacity entries. A capacity
+// of 0 makes oldest always report the zero time.
+func newRingWindow(capacity int) *ringWindow {
+	return &ringWindow{ts: make([]time.Time, capacity)}
+}
+
+// record notes that t was just written to the ring buffer this ringWindow
+// tracks.
+func (w *ringWindow) record(t time.Time) {
+	if len(w.ts) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ts[w.next] = t
+	w.next = (w.next + 1) % len(w.ts)
+	if w.count < len(w.ts) {
+		w.count++
+	}
+}
+
+// oldest returns the timestamp of the oldest entry currently tracked, or the
+// zero time if nothing has been recorded yet.
+func (w *ringWindow) oldest() time.Time {
+	if len(w.ts) == 0 {
+		return time.Time{}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.count == 0 {
+		return time.Time{}
+	}
+	if w.count < len(w.ts) {
+		return w.ts[0]
+	}
+	return w.ts[w.next]
+}
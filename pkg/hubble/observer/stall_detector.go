@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+package observer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/cilium/cilium/pkg/hubble/observer/observeroption"
+)
+
+// errStreamStalled is returned by GetFlows/GetAgentEvents to terminate a
+// Follow subscription that a stall detector configured with
+// TerminateOnStall has determined is stuck. It is distinct from the usual
+// context-cancellation errors so that clients (Relay, the CLI) can tell a
+// detected stall apart from an ordinary disconnect.
+var errStreamStalled = status.Error(codes.ResourceExhausted, "follow subscription stalled: ring buffer advanced without any flow being delivered")
+
+// subscriptionIDs hands out a unique id to every Follow subscription that
+// has a stall detector attached, for the lifetime of the process.
+var subscriptionIDs uint64
+
+func nextSubscriptionID() uint64 {
+	return atomic.AddUint64(&subscriptionIDs, 1)
+}
+
+// streamStallDetector tracks, for a single Follow subscription, how far
+// delivery to that subscriber has fallen behind the newest event the
+// subscription has read from the ring buffer. It mirrors the "censorship
+// monitor" pattern used to watch a slow header stream against a block
+// stream: if the timestamp of the newest event read runs ahead of the
+// timestamp of the last event delivered by more than the configured window,
+// the subscription is considered stalled. Events admitted to the ring buffer
+// that the subscription has not read yet are not taken into account.
+//
+// A nil *streamStallDetector is valid and behaves as a no-op, so that
+// GetFlows/GetAgentEvents do not need to special-case the "no detector
+// configured" case.
+type streamStallDetector struct {
+	cfg            observeroption.StreamStallDetectorConfig
+	subscriptionID uint64
+
+	mu            sync.Mutex
+	lastDelivered time.Time
+	bufferHead    time.Time
+	stalled       bool
+}
+
+// newStreamStallDetector returns a detector configured by cfg, or nil if cfg
+// is nil (i.e. WithStreamStallDetector was not used).
+func newStreamStallDetector(cfg *observeroption.StreamStallDetectorConfig) *streamStallDetector {
+	if cfg == nil {
+		return nil
+	}
+	return &streamStallDetector{
+		cfg:            *cfg,
+		subscriptionID: nextSubscriptionID(),
+	}
+}
+
+// markDelivered records that an event with timestamp t was just successfully
+// delivered to the subscriber.
+func (d *streamStallDetector) markDelivered(t time.Time) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t.After(d.lastDelivered) {
+		d.lastDelivered = t
+	}
+}
+
+// markBufferHead records the timestamp of the newest event the subscription
+// has read from the ring buffer, regardless of whether it was delivered to
+// this subscriber. GetFlows/GetAgentEvents call it with each event as their
+// reader returns it.
+func (d *streamStallDetector) markBufferHead(t time.Time) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if t.After(d.bufferHead) {
+		d.bufferHead = t
+	}
+}
+
+// watch periodically compares lastDelivered against bufferHead and invokes
+// OnStall/OnResume as the subscription transitions between the two states.
+// If the detector is configured with TerminateOnStall, cancel is called the
+// moment a stall is observed so that the blocked GetFlows/GetAgentEvents
+// loop unblocks and can report errStreamStalled. watch returns once ctx is
+// cancelled.
+func (d *streamStallDetector) watch(ctx context.Context, cancel context.CancelFunc) {
+	if d == nil {
+		return
+	}
+	interval := d.cfg.Window / 2
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.check(ctx, cancel)
+		}
+	}
+}
+
+func (d *streamStallDetector) check(ctx context.Context, cancel context.CancelFunc) {
+	d.mu.Lock()
+	lastDelivered, bufferHead, wasStalled := d.lastDelivered, d.bufferHead, d.stalled
+	nowStalled := bufferHead.Sub(lastDelivered) > d.cfg.Window
+	d.stalled = nowStalled
+	d.mu.Unlock()
+
+	switch {
+	case nowStalled && !wasStalled:
+		if d.cfg.OnStall != nil {
+			d.cfg.OnStall(ctx, d.subscriptionID, lastDelivered, bufferHead)
+		}
+		if d.cfg.TerminateOnStall {
+			cancel()
+		}
+	case !nowStalled && wasStalled:
+		if d.cfg.OnResume != nil {
+			d.cfg.OnResume(ctx, d.subscriptionID)
+		}
+	}
+}
+
+// isStalled reports whether the detector currently considers the
+// subscription stalled.
+func (d *streamStallDetector) isStalled() bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stalled
+}
+
+// terminate reports whether the detector was configured to end the stream
+// as soon as a stall is observed.
+func (d *streamStallDetector) terminate() bool {
+	return d != nil && d.cfg.TerminateOnStall
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+//go:build !privileged_tests
+// +build !privileged_tests
+
+package observer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/cilium/pkg/hubble/observer/observeroption"
+)
+
+// TestStreamStallDetector_StallAndResume unit-tests the "producer keeps
+// going, delivery halts" scenario that
+// TestLocalObserverServer_GetFlows_Follow_Stall drives end to end: the ring buffer keeps
+// advancing (markBufferHead) while nothing is delivered (markDelivered is
+// not called), and the detector must report exactly one stall followed by
+// exactly one resume once delivery catches back up.
+func TestStreamStallDetector_StallAndResume(t *testing.T) {
+	var stalls, resumes int
+	var lastSubscriptionID uint64
+
+	cfg := &observeroption.StreamStallDetectorConfig{
+		Window: 20 * time.Millisecond,
+		OnStall: func(_ context.Context, subscriptionID uint64, lastDelivered, headOfBuffer time.Time) {
+			stalls++
+			lastSubscriptionID = subscriptionID
+			assert.True(t, headOfBuffer.Sub(lastDelivered) > cfgWindow)
+		},
+		OnResume: func(_ context.Context, subscriptionID uint64) {
+			resumes++
+			assert.Equal(t, lastSubscriptionID, subscriptionID)
+		},
+	}
+
+	d := newStreamStallDetector(cfg)
+	require.NotNil(t, d)
+
+	ctx := context.Background()
+	cancel := func() {}
+
+	base := time.Unix(0, 0)
+	d.markDelivered(base)
+	d.markBufferHead(base)
+	d.check(ctx, cancel)
+	assert.Equal(t, 0, stalls)
+
+	// producer keeps advancing the ring buffer, nothing gets delivered
+	d.markBufferHead(base.Add(time.Second))
+	d.check(ctx, cancel)
+	assert.Equal(t, 1, stalls)
+	assert.Equal(t, 0, resumes)
+
+	// a later check while still stalled must not fire OnStall again
+	d.markBufferHead(base.Add(2 * time.Second))
+	d.check(ctx, cancel)
+	assert.Equal(t, 1, stalls)
+
+	// delivery catches back up with the head of the buffer
+	d.markDelivered(base.Add(2 * time.Second))
+	d.check(ctx, cancel)
+	assert.Equal(t, 1, resumes)
+}
+
+var cfgWindow = 20 * time.Millisecond
+
+func TestStreamStallDetector_TerminateOnStall(t *testing.T) {
+	cfg := &observeroption.StreamStallDetectorConfig{
+		Window:           time.Millisecond,
+		TerminateOnStall: true,
+	}
+	d := newStreamStallDetector(cfg)
+	require.NotNil(t, d)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := time.Unix(0, 0)
+	d.markDelivered(base)
+	d.markBufferHead(base.Add(time.Second))
+
+	assert.True(t, d.terminate())
+	assert.False(t, d.isStalled())
+	d.check(ctx, cancel)
+	assert.True(t, d.isStalled())
+
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("expected stall detector to cancel the stream context")
+	}
+}
+
+func TestStreamStallDetector_Nil(t *testing.T) {
+	var d *streamStallDetector
+	d.markDelivered(time.Now())
+	d.markBufferHead(time.Now())
+	assert.False(t, d.isStalled())
+	assert.False(t, d.terminate())
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	flowpb "github.com/cilium/cilium/api/v1/flow"
+)
+
+// RecordKind identifies the kind of Hubble event a Record carries.
+type RecordKind uint8
+
+const (
+	// RecordKindFlow marks a Record carrying a marshaled flowpb.Flow.
+	RecordKindFlow RecordKind = iota + 1
+	// RecordKindAgentEvent marks a Record carrying a marshaled
+	// flowpb.AgentEvent.
+	RecordKindAgentEvent
+)
+
+// recordHeaderSize is the size, in bytes, of the fixed-size header that
+// precedes the marshaled protobuf body within a Record's on-disk
+// representation: an 8 byte unix-nano timestamp followed by a 1 byte kind.
+const recordHeaderSize = 8 + 1
+
+// Record is a single WAL entry: one Hubble flow or agent event plus the
+// timestamp it was observed at.
+type Record struct {
+	Timestamp  time.Time
+	Kind       RecordKind
+	Flow       *flowpb.Flow
+	AgentEvent *flowpb.AgentEvent
+}
+
+// encodeRecord serializes rec into the fixed-header-plus-protobuf-body
+// representation that segment.append writes out length-prefixed and
+// CRC-protected.
+func encodeRecord(rec *Record) ([]byte, error) {
+	var body []byte
+	var err error
+	switch rec.Kind {
+	case RecordKindFlow:
+		body, err = proto.Marshal(rec.Flow)
+	case RecordKindAgentEvent:
+		body, err = proto.Marshal(rec.AgentEvent)
+	default:
+		return nil, fmt.Errorf("wal: unknown record kind %d", rec.Kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("wal: failed to marshal record: %w", err)
+	}
+
+	buf := make([]byte, recordHeaderSize+len(body))
+	binary.BigEndian.PutUint64(buf[0:8], uint64(rec.Timestamp.UnixNano()))
+	buf[8] = byte(rec.Kind)
+	copy(buf[recordHeaderSize:], body)
+	return buf, nil
+}
+
+func decodeRecord(payload []byte) (*Record, error) {
+	if len(payload) < recordHeaderSize {
+		return nil, fmt.Errorf("wal: truncated record header")
+	}
+	ts := time.Unix(0, int64(binary.BigEndian.Uint64(payload[0:8]))).UTC()
+	kind := RecordKind(payload[8])
+	body := payload[recordHeaderSize:]
+
+	rec := &Record{Timestamp: ts, Kind: kind}
+	switch kind {
+	case RecordKindFlow:
+		flow := &flowpb.Flow{}
+		if err := proto.Unmarshal(body, flow); err != nil {
+			return nil, fmt.Errorf("wal: failed to unmarshal flow record: %w", err)
+		}
+		rec.Flow = flow
+	case RecordKindAgentEvent:
+		ev := &flowpb.AgentEvent{}
+		if err := proto.Unmarshal(body, ev); err != nil {
+			return nil, fmt.Errorf("wal: failed to unmarshal agent event record: %w", err)
+		}
+		rec.AgentEvent = ev
+	default:
+		return nil, fmt.Errorf("wal: unknown record kind %d", kind)
+	}
+	return rec, nil
+}
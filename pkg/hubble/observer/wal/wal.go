@@ -0,0 +1,249 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+// Package wal implements a persistent, segmented write-ahead log that
+// mirrors the flows and agent events admitted to a Hubble observer's ring
+// buffer, so that recent history survives an agent restart.
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures segment rotation and retention for a WAL.
+type Options struct {
+	// MaxSegmentBytes is the size at which the active segment is rotated
+	// to a new file.
+	MaxSegmentBytes int64
+	// MaxSegments is the number of segments to retain, counting the active
+	// one. 0 means unlimited.
+	MaxSegments int
+	// MaxAge is the maximum age of a rotated segment before the compactor
+	// removes it. 0 means unlimited.
+	MaxAge time.Duration
+	// CompactInterval is how often the background compactor runs.
+	CompactInterval time.Duration
+}
+
+// Default are reasonable defaults for a WAL opened without further tuning.
+var Default = Options{
+	MaxSegmentBytes: 64 << 20,
+	MaxSegments:     8,
+	MaxAge:          24 * time.Hour,
+	CompactInterval: time.Minute,
+}
+
+// WAL is an append-only, segmented write-ahead log of Records, with a
+// background compactor that enforces retention.
+type WAL struct {
+	dir  string
+	opts Options
+
+	mu      sync.Mutex
+	nextSeq uint64
+	active  *segment
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Open opens (creating if necessary) a WAL rooted at dir and starts its
+// background compactor. It does not itself replay existing segments; call
+// Replay for that.
+func Open(dir string, opts Options) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory %q: %w", dir, err)
+	}
+
+	w := &WAL{dir: dir, opts: opts, closed: make(chan struct{})}
+
+	existing, err := w.segmentPaths()
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		seq, err := segmentSeq(existing[len(existing)-1])
+		if err != nil {
+			return nil, err
+		}
+		w.nextSeq = seq + 1
+	}
+
+	seg, err := createSegment(dir, w.nextSeq)
+	if err != nil {
+		return nil, err
+	}
+	w.active = seg
+	w.nextSeq++
+
+	go w.compactLoop()
+	return w, nil
+}
+
+// Append encodes and appends rec to the active segment, fsyncing before it
+// returns, rotating to a new segment first if doing so would exceed
+// MaxSegmentBytes.
+func (w *WAL) Append(rec *Record) error {
+	payload, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.opts.MaxSegmentBytes > 0 && w.active.size+int64(segmentRecordHeaderSize+len(payload)) > w.opts.MaxSegmentBytes {
+		if err := w.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	if err := w.active.append(payload); err != nil {
+		return err
+	}
+	return w.active.sync()
+}
+
+func (w *WAL) rotateLocked() error {
+	if err := w.active.close(); err != nil {
+		return err
+	}
+	seg, err := createSegment(w.dir, w.nextSeq)
+	if err != nil {
+		return err
+	}
+	w.active = seg
+	w.nextSeq++
+	return nil
+}
+
+// Replay returns every record in the WAL whose timestamp is at or after
+// since, ordered oldest first. A segment's final record is silently
+// discarded if it fails its CRC check, which is how Replay tolerates a
+// process that crashed mid-write.
+func (w *WAL) Replay(since time.Time) ([]*Record, error) {
+	paths, err := w.segmentPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*Record
+	for _, path := range paths {
+		raw, err := readSegment(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, payload := range raw {
+			rec, err := decodeRecord(payload)
+			if err != nil {
+				continue
+			}
+			if rec.Timestamp.Before(since) {
+				continue
+			}
+			records = append(records, rec)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Timestamp.Before(records[j].Timestamp) })
+	return records, nil
+}
+
+// Status reports the current segment count, total on-disk bytes, and the
+// timestamp of the first record in the oldest segment that holds one (the
+// zero time if the WAL holds no records).
+func (w *WAL) Status() (segments int, bytes int64, oldest time.Time) {
+	paths, err := w.segmentPaths()
+	if err != nil {
+		return 0, 0, time.Time{}
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		bytes += info.Size()
+		if oldest.IsZero() {
+			if raw, err := readSegment(path); err == nil && len(raw) > 0 {
+				if rec, err := decodeRecord(raw[0]); err == nil {
+					oldest = rec.Timestamp
+				}
+			}
+		}
+	}
+	return len(paths), bytes, oldest
+}
+
+// Close flushes and closes the active segment and stops the compactor.
+func (w *WAL) Close() error {
+	w.closeOnce.Do(func() { close(w.closed) })
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.active.close()
+}
+
+// compactLoop periodically drops rotated segments that are older than
+// MaxAge or that exceed MaxSegments, oldest first. It never touches the
+// active segment.
+func (w *WAL) compactLoop() {
+	interval := w.opts.CompactInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.closed:
+			return
+		case <-ticker.C:
+			w.compact()
+		}
+	}
+}
+
+func (w *WAL) compact() {
+	paths, err := w.segmentPaths()
+	if err != nil || len(paths) <= 1 {
+		return
+	}
+	rotated := paths[:len(paths)-1] // never remove the active segment
+
+	cutoff := time.Now().Add(-w.opts.MaxAge)
+	excess := len(rotated)
+	if w.opts.MaxSegments > 0 {
+		excess = len(rotated) - (w.opts.MaxSegments - 1)
+	}
+
+	for i, path := range rotated {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		tooOld := w.opts.MaxAge > 0 && info.ModTime().Before(cutoff)
+		tooMany := w.opts.MaxSegments > 0 && i < excess
+		if tooOld || tooMany {
+			os.Remove(path)
+		}
+	}
+}
+
+func (w *WAL) segmentPaths() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WAL directory %q: %w", w.dir, err)
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), segmentSuffix) {
+			paths = append(paths, filepath.Join(w.dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+// Package service defines a small, common lifecycle interface for the
+// long-running components that make up a Hubble observer (the local
+// observer server, agent-event dispatchers, hook runners, ...), so that
+// they can be started, stopped and composed the same way regardless of what
+// they do internally.
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Service is the common lifecycle of a long-running Hubble observer
+// component.
+type Service interface {
+	// Start begins the service's run loop. It returns once the loop has
+	// been scheduled, not once it has finished; use Wait to block until
+	// the service has stopped. Start is idempotent: calling it again while
+	// the service is already running is a no-op.
+	Start(ctx context.Context) error
+	// Stop requests that the run loop exit. It does not block until the
+	// service has actually stopped; use Wait for that.
+	Stop() error
+	// Wait returns a channel that is closed once the run loop has exited,
+	// whether because Stop was called or because its context was
+	// otherwise cancelled.
+	Wait() <-chan struct{}
+	// IsRunning reports whether the run loop is currently active.
+	IsRunning() bool
+}
+
+// BaseService is an embeddable implementation of the bookkeeping common to
+// every Service: idempotent start/stop, a single shutdown channel, panic
+// recovery in the run loop, and structured logging of state transitions.
+// Embedders implement their own Start method by delegating to Run with
+// their run loop as the argument:
+//
+//	func (s *MyServer) Start(ctx context.Context) error {
+//		return s.BaseService.Run(ctx, s.run)
+//	}
+type BaseService struct {
+	logger *logrus.Entry
+
+	mu      sync.Mutex
+	running bool
+	stopped chan struct{}
+	cancel  context.CancelFunc
+}
+
+// NewBaseService returns a BaseService ready to be embedded. name is used
+// only to annotate log messages about the service's state transitions.
+func NewBaseService(logger *logrus.Logger, name string) *BaseService {
+	return &BaseService{
+		logger:  logger.WithField("service", name),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Run starts fn in a new goroutine under a context derived from ctx, which
+// Stop cancels. If the service is already running, Run is a no-op and
+// returns nil, matching Service.Start's idempotency requirement. A panic
+// inside fn is recovered, logged, and treated as fn returning: the service
+// transitions to stopped rather than taking the process down with it.
+//
+// Run is also safe to call again after a previous run has stopped, with or
+// without an intervening Reset: it always allocates a fresh stopped channel
+// for the new run rather than reusing the one the previous run already
+// closed.
+func (b *BaseService) Run(ctx context.Context, fn func(ctx context.Context)) error {
+	b.mu.Lock()
+	if b.running {
+		b.mu.Unlock()
+		return nil
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	b.cancel = cancel
+	b.running = true
+	b.stopped = make(chan struct{})
+	stopped := b.stopped
+	b.mu.Unlock()
+
+	b.logger.Info("service starting")
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				b.logger.WithField("panic", r).Error("service panicked, stopping")
+			}
+			b.mu.Lock()
+			b.running = false
+			b.mu.Unlock()
+			b.logger.Info("service stopped")
+			close(stopped)
+		}()
+		fn(runCtx)
+	}()
+	return nil
+}
+
+// Stop cancels the context passed to the running fn, if any. It is safe to
+// call Stop on a service that was never started or has already stopped.
+func (b *BaseService) Stop() error {
+	b.mu.Lock()
+	cancel := b.cancel
+	b.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	return nil
+}
+
+// Wait returns a channel that is closed once the run loop started by Run
+// has exited.
+func (b *BaseService) Wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stopped
+}
+
+// IsRunning reports whether Run's goroutine is currently active.
+func (b *BaseService) IsRunning() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.running
+}
+
+// Reset reinitializes the service's lifecycle state so that Run can be
+// called again after a Stop, as if the BaseService were freshly
+// constructed. It is intended for tests that reuse a single server across
+// multiple start/stop cycles; it is not safe to call while the service is
+// running.
+func (b *BaseService) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running = false
+	b.cancel = nil
+	b.stopped = make(chan struct{})
+}
@@ -0,0 +1,118 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Hubble
+
+//go:build !privileged_tests
+// +build !privileged_tests
+
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return l
+}
+
+type testService struct {
+	*BaseService
+	ran chan struct{}
+}
+
+func newTestService(t *testing.T) *testService {
+	return &testService{
+		BaseService: NewBaseService(newTestLogger(), "test"),
+		ran:         make(chan struct{}, 1),
+	}
+}
+
+func (s *testService) Start(ctx context.Context) error {
+	return s.Run(ctx, func(ctx context.Context) {
+		s.ran <- struct{}{}
+		<-ctx.Done()
+	})
+}
+
+func TestBaseService_StartStopIsIdempotent(t *testing.T) {
+	s := newTestService(t)
+	assert.False(t, s.IsRunning())
+
+	require.NoError(t, s.Start(context.Background()))
+	<-s.ran
+	assert.True(t, s.IsRunning())
+
+	// starting again while running must be a no-op, not a second run loop
+	require.NoError(t, s.Start(context.Background()))
+	select {
+	case <-s.ran:
+		t.Fatal("Start should be idempotent while already running")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	require.NoError(t, s.Stop())
+	<-s.Wait()
+	assert.False(t, s.IsRunning())
+
+	// stopping an already-stopped service must not block or panic
+	require.NoError(t, s.Stop())
+}
+
+func TestBaseService_RecoversPanic(t *testing.T) {
+	s := &testService{BaseService: NewBaseService(newTestLogger(), "test")}
+	started := make(chan struct{})
+	err := s.Run(context.Background(), func(ctx context.Context) {
+		close(started)
+		panic("boom")
+	})
+	require.NoError(t, err)
+
+	<-started
+	select {
+	case <-s.Wait():
+	case <-time.After(time.Second):
+		t.Fatal("a panic in the run loop must still close Wait()")
+	}
+	assert.False(t, s.IsRunning())
+}
+
+func TestBaseService_RestartWithoutReset(t *testing.T) {
+	s := newTestService(t)
+	require.NoError(t, s.Start(context.Background()))
+	<-s.ran
+	require.NoError(t, s.Stop())
+	<-s.Wait()
+
+	// Restarting without an intervening Reset must not panic by closing the
+	// previous run's already-closed stopped channel.
+	require.NoError(t, s.Start(context.Background()))
+	<-s.ran
+	assert.True(t, s.IsRunning())
+
+	require.NoError(t, s.Stop())
+	<-s.Wait()
+	assert.False(t, s.IsRunning())
+}
+
+func TestBaseService_Reset(t *testing.T) {
+	s := newTestService(t)
+	require.NoError(t, s.Start(context.Background()))
+	<-s.ran
+	require.NoError(t, s.Stop())
+	<-s.Wait()
+
+	s.Reset()
+	require.NoError(t, s.Start(context.Background()))
+	<-s.ran
+	assert.True(t, s.IsRunning())
+	require.NoError(t, s.Stop())
+	<-s.Wait()
+}